@@ -0,0 +1,83 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Authorizer determines which partner IDs the caller of a request is
+// entitled to see events for. Implementations should return a non-nil map;
+// an empty one means the caller presented no partner claims and is
+// entitled to see nothing.
+type Authorizer interface {
+	AllowedPartners(r *http.Request) map[string]bool
+}
+
+// AuthorizerFunc adapts a plain function to the Authorizer interface.
+type AuthorizerFunc func(r *http.Request) map[string]bool
+
+// AllowedPartners implements Authorizer.
+func (f AuthorizerFunc) AllowedPartners(r *http.Request) map[string]bool {
+	return f(r)
+}
+
+// HeaderAuthorizer is a simple Authorizer backed by a comma-separated list
+// of partner IDs in a single request header. It exists for tests and for
+// deployments that sit behind a gateway that already turns a JWT claim
+// into a header; production use should prefer something that inspects the
+// claim directly.
+type HeaderAuthorizer struct {
+	// Header is the name of the request header holding the caller's
+	// comma-separated partner IDs, e.g. "X-Partner-IDs".
+	Header string
+}
+
+// AllowedPartners implements Authorizer.
+func (h HeaderAuthorizer) AllowedPartners(r *http.Request) map[string]bool {
+	raw := r.Header.Get(h.Header)
+	allowed := make(map[string]bool)
+	if raw == "" {
+		return allowed
+	}
+
+	for _, id := range strings.Split(raw, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			allowed[id] = true
+		}
+	}
+	return allowed
+}
+
+// partnerAllowed reports whether partnerIDs intersects allowed. A nil
+// allowed set means authorization isn't in effect and everything is
+// allowed; a non-nil but empty set means the caller has no claims and
+// nothing is allowed.
+func partnerAllowed(allowed map[string]bool, partnerIDs []string) bool {
+	if allowed == nil {
+		return true
+	}
+
+	for _, id := range partnerIDs {
+		if allowed[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderAuthorizerAllowedPartners(t *testing.T) {
+	tests := []struct {
+		description   string
+		headerValue   string
+		expectedAllow map[string]bool
+	}{
+		{
+			description:   "No Header Denies All",
+			expectedAllow: map[string]bool{},
+		},
+		{
+			description:   "Single Partner",
+			headerValue:   "partner1",
+			expectedAllow: map[string]bool{"partner1": true},
+		},
+		{
+			description:   "Multiple Partners",
+			headerValue:   "partner1, partner2",
+			expectedAllow: map[string]bool{"partner1": true, "partner2": true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			authorizer := HeaderAuthorizer{Header: "X-Partner-IDs"}
+
+			request := httptest.NewRequest("GET", "/", nil)
+			if tc.headerValue != "" {
+				request.Header.Set("X-Partner-IDs", tc.headerValue)
+			}
+
+			assert.Equal(tc.expectedAllow, authorizer.AllowedPartners(request))
+		})
+	}
+}
+
+func TestPartnerAllowed(t *testing.T) {
+	tests := []struct {
+		description string
+		allowed     map[string]bool
+		partnerIDs  []string
+		expected    bool
+	}{
+		{
+			description: "No Authorizer Configured",
+			allowed:     nil,
+			partnerIDs:  []string{"partner1"},
+			expected:    true,
+		},
+		{
+			description: "No Claims",
+			allowed:     map[string]bool{},
+			partnerIDs:  []string{"partner1"},
+			expected:    false,
+		},
+		{
+			description: "Intersects",
+			allowed:     map[string]bool{"partner2": true},
+			partnerIDs:  []string{"partner1", "partner2"},
+			expected:    true,
+		},
+		{
+			description: "Does Not Intersect",
+			allowed:     map[string]bool{"partner3": true},
+			partnerIDs:  []string{"partner1", "partner2"},
+			expected:    false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, partnerAllowed(tc.allowed, tc.partnerIDs))
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressionThreshold is the minimum response body size, in bytes, worth
+// paying the gzip overhead for. Smaller bodies are sent as-is.
+const compressionThreshold = 256
+
+// compressionLevel is the minimum gzip level used when compressing event
+// responses; favor speed over ratio since this runs on every request.
+const compressionLevel = gzip.BestSpeed
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		zw, _ := gzip.NewWriterLevel(nil, compressionLevel)
+		return zw
+	},
+}
+
+// negotiateEncoding wraps next so that, when the caller's Accept-Encoding
+// advertises gzip, the response body is buffered and transparently
+// gzip-compressed before being written. br is not negotiated: this package
+// has no brotli encoder available without vendoring one in, so a br-only
+// client falls back to an uncompressed response rather than lying about
+// Content-Encoding.
+func negotiateEncoding(measures Measures, endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressingResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+			gzipOK:         acceptsGzip(r.Header.Get("Accept-Encoding")),
+		}
+		next(cw, r)
+		cw.flush(measures, endpoint)
+	}
+}
+
+func acceptsGzip(acceptEncoding string) bool {
+	for _, encoding := range strings.Split(acceptEncoding, ",") {
+		if strings.HasPrefix(strings.TrimSpace(encoding), "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// compressingResponseWriter buffers a handler's response so the decision to
+// compress can be made once the final body size is known.
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	gzipOK bool
+	buf    bytes.Buffer
+}
+
+func (w *compressingResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *compressingResponseWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// flush sends the buffered body to the underlying ResponseWriter, gzipping
+// it first when it's large enough to be worth it, and records the
+// before/after sizes and compression ratio for endpoint.
+func (w *compressingResponseWriter) flush(measures Measures, endpoint string) {
+	body := w.buf.Bytes()
+	measures.BytesInCount.With("endpoint", endpoint).Add(float64(len(body)))
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if !w.gzipOK || len(body) < compressionThreshold {
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(body)
+		measures.BytesOutCount.With("endpoint", endpoint).Add(float64(len(body)))
+		return
+	}
+
+	zw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(zw)
+
+	var compressed bytes.Buffer
+	zw.Reset(&compressed)
+	if _, err := zw.Write(body); err != nil || zw.Close() != nil {
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(body)
+		measures.BytesOutCount.With("endpoint", endpoint).Add(float64(len(body)))
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(compressed.Bytes())
+
+	measures.BytesOutCount.With("endpoint", endpoint).Add(float64(compressed.Len()))
+	if compressed.Len() > 0 {
+		measures.CompressionRatio.With("endpoint", endpoint).Set(float64(len(body)) / float64(compressed.Len()))
+	}
+}
@@ -0,0 +1,109 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/webpa-common/xmetrics/xmetricstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	largeBody := strings.Repeat("a", compressionThreshold*2)
+
+	tests := []struct {
+		description        string
+		acceptEncoding     string
+		body               string
+		expectedEncoding   string
+		expectedBodyOnWire string
+	}{
+		{
+			description:        "No Accept-Encoding",
+			body:               largeBody,
+			expectedEncoding:   "",
+			expectedBodyOnWire: largeBody,
+		},
+		{
+			description:        "Gzip Requested, Below Threshold",
+			acceptEncoding:     "gzip",
+			body:               "short",
+			expectedEncoding:   "",
+			expectedBodyOnWire: "short",
+		},
+		{
+			description:      "Gzip Requested, Above Threshold",
+			acceptEncoding:   "gzip",
+			body:             largeBody,
+			expectedEncoding: "gzip",
+		},
+		{
+			description:      "Gzip Requested Among Others",
+			acceptEncoding:   "br, gzip;q=0.8",
+			body:             largeBody,
+			expectedEncoding: "gzip",
+		},
+		{
+			description:        "Only Br Requested Falls Back",
+			acceptEncoding:     "br",
+			body:               largeBody,
+			expectedEncoding:   "",
+			expectedBodyOnWire: largeBody,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			p := xmetricstest.NewProvider(nil, Metrics)
+			measures := NewMeasures(p)
+
+			handler := negotiateEncoding(measures, "status", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tc.body))
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			rr := httptest.NewRecorder()
+
+			handler(rr, request)
+
+			assert.Equal(tc.expectedEncoding, rr.Header().Get("Content-Encoding"))
+
+			if tc.expectedEncoding == "gzip" {
+				reader, err := gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+				assert.Nil(err)
+				decompressed, err := ioutil.ReadAll(reader)
+				assert.Nil(err)
+				assert.Equal(tc.body, string(decompressed))
+				assert.Contains(rr.Header().Get("Vary"), "Accept-Encoding")
+			} else {
+				assert.Equal(tc.expectedBodyOnWire, rr.Body.String())
+			}
+
+			p.Assert(t, BytesInCounter, "endpoint", "status")(xmetricstest.Value(float64(len(tc.body))))
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/provider"
+)
+
+// metric names
+const (
+	UnmarshalFailureCounter = "unmarshal_failure_count"
+	BytesInCounter          = "bytes_in_count"
+	BytesOutCounter         = "bytes_out_count"
+	CompressionRatioGauge   = "compression_ratio"
+	PartnerFilteredCounter  = "partner_filtered_count"
+)
+
+// Metrics returns the defined metrics for this application to be used by xmetrics.
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: UnmarshalFailureCounter,
+			Type: "counter",
+			Help: "The total number of records that failed to unmarshal into an event",
+		},
+		{
+			Name:       BytesInCounter,
+			Type:       "counter",
+			Help:       "The total size, in bytes, of response bodies produced by an endpoint before compression",
+			LabelNames: []string{"endpoint"},
+		},
+		{
+			Name:       BytesOutCounter,
+			Type:       "counter",
+			Help:       "The total size, in bytes, of response bodies an endpoint actually wrote to the client",
+			LabelNames: []string{"endpoint"},
+		},
+		{
+			Name:       CompressionRatioGauge,
+			Type:       "gauge",
+			Help:       "The ratio of uncompressed to compressed size of the most recent compressed response from an endpoint",
+			LabelNames: []string{"endpoint"},
+		},
+		{
+			Name: PartnerFilteredCounter,
+			Type: "counter",
+			Help: "The total number of events dropped because the caller wasn't authorized to see their partner",
+		},
+	}
+}
+
+// Measures holds the metrics used throughout this application.
+type Measures struct {
+	UnmarshalFailureCount metrics.Counter
+	BytesInCount          metrics.Counter
+	BytesOutCount         metrics.Counter
+	CompressionRatio      metrics.Gauge
+	PartnerFilteredCount  metrics.Counter
+}
+
+// NewMeasures creates a new Measures struct from the given provider.
+func NewMeasures(p provider.Provider) Measures {
+	return Measures{
+		UnmarshalFailureCount: p.NewCounter(UnmarshalFailureCounter),
+		BytesInCount:          p.NewCounter(BytesInCounter),
+		BytesOutCount:         p.NewCounter(BytesOutCounter),
+		CompressionRatio:      p.NewGauge(CompressionRatioGauge),
+		PartnerFilteredCount:  p.NewCounter(PartnerFilteredCounter),
+	}
+}
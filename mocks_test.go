@@ -0,0 +1,52 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Comcast/codex/db"
+)
+
+type mockRecordGetter struct {
+	mock.Mock
+}
+
+func (m *mockRecordGetter) GetRecordsInRange(ctx context.Context, deviceID string, since, until int64, limit int, afterID uint64) ([]db.Record, error) {
+	args := m.Called(ctx, deviceID, since, until, limit, afterID)
+	return args.Get(0).([]db.Record), args.Error(1)
+}
+
+type mockEventSubscriber struct {
+	mock.Mock
+}
+
+func (m *mockEventSubscriber) Subscribe(deviceID string) (<-chan db.Record, func(), error) {
+	args := m.Called(deviceID)
+	var ch <-chan db.Record
+	if c := args.Get(0); c != nil {
+		ch = c.(<-chan db.Record)
+	}
+	var cancel func()
+	if c := args.Get(1); c != nil {
+		cancel = c.(func())
+	}
+	return ch, cancel, args.Error(2)
+}
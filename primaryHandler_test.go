@@ -18,10 +18,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -30,6 +34,7 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/Comcast/codex/db"
 )
@@ -81,6 +86,7 @@ func TestGetDeviceInfo(t *testing.T) {
 		expectedEvents        []db.Event
 		expectedErr           error
 		expectedStatus        int
+		expectedHasMore       bool
 	}{
 		{
 			description:    "Get Records Error",
@@ -132,13 +138,25 @@ func TestGetDeviceInfo(t *testing.T) {
 				goodEvent,
 			},
 		},
+		{
+			description: "All Expired Mid-History Page Still Pages",
+			recordsToReturn: []db.Record{
+				{ID: 1, DeathDate: previousTime},
+				{ID: 2, DeathDate: previousTime},
+				{ID: 3, DeathDate: previousTime},
+				{ID: 4, DeathDate: previousTime},
+				{ID: 5, DeathDate: previousTime},
+			},
+			expectedEvents:  []db.Event{},
+			expectedHasMore: true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
 			assert := assert.New(t)
 			mockGetter := new(mockRecordGetter)
-			mockGetter.On("GetRecords", "test", 5).Return(tc.recordsToReturn, tc.getRecordsErr).Once()
+			mockGetter.On("GetRecordsInRange", mock.Anything, "test", int64(0), int64(0), 5, uint64(0)).Return(tc.recordsToReturn, tc.getRecordsErr).Once()
 			p := xmetricstest.NewProvider(nil, Metrics)
 			m := NewMeasures(p)
 			app := App{
@@ -148,9 +166,10 @@ func TestGetDeviceInfo(t *testing.T) {
 				getLimit:    5,
 			}
 			p.Assert(t, UnmarshalFailureCounter)(xmetricstest.Value(0.0))
-			events, err := app.getDeviceInfo("test")
+			page, err := app.getDeviceInfo(context.Background(), "test", 0, 0, 5, 0, nil)
 			p.Assert(t, UnmarshalFailureCounter)(xmetricstest.Value(tc.expectedFailureMetric))
-			assert.Equal(tc.expectedEvents, events)
+			assert.Equal(tc.expectedEvents, page.events)
+			assert.Equal(tc.expectedHasMore, page.hasMore)
 
 			if tc.expectedErr == nil || err == nil {
 				assert.Equal(tc.expectedErr, err)
@@ -166,6 +185,79 @@ func TestGetDeviceInfo(t *testing.T) {
 	}
 }
 
+func TestGetDeviceInfoPartnerFiltering(t *testing.T) {
+	event1 := goodEvent
+	event1.PartnerIDs = []string{"partner1"}
+	event2 := goodEvent
+	event2.PartnerIDs = []string{"partner1", "partner2"}
+
+	data1, err := json.Marshal(&event1)
+	assert.New(t).Nil(err)
+	data2, err := json.Marshal(&event2)
+	assert.New(t).Nil(err)
+
+	futureTime := time.Now().Add(time.Duration(50000) * time.Minute).Unix()
+	records := []db.Record{
+		{ID: 1, DeathDate: futureTime, Data: data1},
+		{ID: 2, DeathDate: futureTime, Data: data2},
+	}
+
+	tests := []struct {
+		description     string
+		allowedPartners map[string]bool
+		expectedEvents  []db.Event
+		expectedStatus  int
+	}{
+		{
+			description:     "No Claims Denies All",
+			allowedPartners: map[string]bool{},
+			expectedEvents:  []db.Event{},
+			expectedStatus:  http.StatusNotFound,
+		},
+		{
+			description:     "Single Partner Match",
+			allowedPartners: map[string]bool{"partner2": true},
+			expectedEvents:  []db.Event{event2},
+		},
+		{
+			description:     "Multi Partner Intersection",
+			allowedPartners: map[string]bool{"partner1": true},
+			expectedEvents:  []db.Event{event1, event2},
+		},
+		{
+			description:     "No Authorizer Configured Allows All",
+			allowedPartners: nil,
+			expectedEvents:  []db.Event{event1, event2},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			mockGetter := new(mockRecordGetter)
+			mockGetter.On("GetRecordsInRange", mock.Anything, "test", int64(0), int64(0), 5, uint64(0)).Return(records, nil).Once()
+			p := xmetricstest.NewProvider(nil, Metrics)
+			app := App{
+				eventGetter: mockGetter,
+				logger:      logging.DefaultLogger(),
+				measures:    NewMeasures(p),
+				getLimit:    5,
+			}
+
+			page, err := app.getDeviceInfo(context.Background(), "test", 0, 0, 5, 0, tc.allowedPartners)
+
+			if tc.expectedStatus > 0 {
+				statusCodeErr, ok := err.(kithttp.StatusCoder)
+				assert.True(ok, "expected error to have a status code")
+				assert.Equal(tc.expectedStatus, statusCodeErr.StatusCode())
+			} else {
+				assert.Nil(err)
+			}
+			assert.Equal(tc.expectedEvents, page.events)
+		})
+	}
+}
+
 func TestHandleGetEvents(t *testing.T) {
 	testassert := assert.New(t)
 	futureTime := time.Now().Add(time.Duration(50000) * time.Minute).Unix()
@@ -175,9 +267,13 @@ func TestHandleGetEvents(t *testing.T) {
 	tests := []struct {
 		description        string
 		deviceID           string
+		rawQuery           string
 		recordsToReturn    []db.Record
+		expectedLimit      int
+		expectedAfterID    uint64
 		expectedStatusCode int
 		expectedBody       []byte
+		expectLinkHeader   bool
 	}{
 		{
 			description:        "Empty Device ID Error",
@@ -187,6 +283,7 @@ func TestHandleGetEvents(t *testing.T) {
 		{
 			description:        "Get Device Info Error",
 			deviceID:           "1234",
+			expectedLimit:      5,
 			expectedStatusCode: http.StatusNotFound,
 		},
 		{
@@ -199,16 +296,40 @@ func TestHandleGetEvents(t *testing.T) {
 					Data:      goodData,
 				},
 			},
+			expectedLimit:      5,
 			expectedStatusCode: http.StatusOK,
 			expectedBody:       goodData,
 		},
+		{
+			description:        "Invalid Limit Error",
+			deviceID:           "1234",
+			rawQuery:           "limit=notanumber",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			description: "Pagination Query Params",
+			deviceID:    "1234",
+			rawQuery:    "limit=2&after=10",
+			recordsToReturn: []db.Record{
+				{ID: 11, DeathDate: futureTime, Data: goodData},
+				{ID: 12, DeathDate: futureTime, Data: goodData},
+			},
+			expectedLimit:      2,
+			expectedAfterID:    10,
+			expectedStatusCode: http.StatusOK,
+			expectLinkHeader:   true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
 			assert := assert.New(t)
 			mockGetter := new(mockRecordGetter)
-			mockGetter.On("GetRecords", tc.deviceID, 5).Return(tc.recordsToReturn, nil).Once()
+			limit := tc.expectedLimit
+			if limit == 0 {
+				limit = 5
+			}
+			mockGetter.On("GetRecordsInRange", mock.Anything, tc.deviceID, int64(0), int64(0), limit, tc.expectedAfterID).Return(tc.recordsToReturn, nil).Maybe()
 			app := App{
 				eventGetter: mockGetter,
 				getLimit:    5,
@@ -216,11 +337,216 @@ func TestHandleGetEvents(t *testing.T) {
 			}
 			rr := httptest.NewRecorder()
 			request := mux.SetURLVars(
-				httptest.NewRequest("GET", "/1234/status", nil),
+				httptest.NewRequest("GET", "/1234/status?"+tc.rawQuery, nil),
 				map[string]string{"deviceID": tc.deviceID},
 			)
 			app.handleGetEvents(rr, request)
 			assert.Equal(tc.expectedStatusCode, rr.Code)
+			if tc.expectLinkHeader {
+				assert.Contains(rr.Header().Get("Link"), `rel="next"`)
+			} else {
+				assert.Empty(rr.Header().Get("Link"))
+			}
 		})
 	}
 }
+
+// nonFlushingResponseWriter satisfies http.ResponseWriter but deliberately
+// not http.Flusher, for exercising handleStreamEvents' Flusher check.
+type nonFlushingResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *nonFlushingResponseWriter) Header() http.Header         { return w.header }
+func (w *nonFlushingResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *nonFlushingResponseWriter) WriteHeader(status int)      { w.status = status }
+
+// syncBuffer is a bytes.Buffer safe for one writer goroutine and one reader
+// goroutine, for observing an SSE stream as it's written.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHandleStreamEvents(t *testing.T) {
+	t.Run("Empty Device ID", func(t *testing.T) {
+		assert := assert.New(t)
+		app := App{logger: logging.DefaultLogger()}
+		rr := httptest.NewRecorder()
+		request := mux.SetURLVars(
+			httptest.NewRequest(http.MethodGet, "/events", nil),
+			map[string]string{"deviceID": ""},
+		)
+		app.handleStreamEvents(rr, request)
+		assert.Equal(http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("No Subscriber Configured", func(t *testing.T) {
+		assert := assert.New(t)
+		app := App{logger: logging.DefaultLogger()}
+		rr := httptest.NewRecorder()
+		request := mux.SetURLVars(
+			httptest.NewRequest(http.MethodGet, "/1234/events", nil),
+			map[string]string{"deviceID": "1234"},
+		)
+		app.handleStreamEvents(rr, request)
+		assert.Equal(http.StatusNotImplemented, rr.Code)
+	})
+
+	t.Run("ResponseWriter Not A Flusher", func(t *testing.T) {
+		assert := assert.New(t)
+		mockSub := new(mockEventSubscriber)
+		app := App{subscriber: mockSub, logger: logging.DefaultLogger()}
+		request := mux.SetURLVars(
+			httptest.NewRequest(http.MethodGet, "/1234/events", nil),
+			map[string]string{"deviceID": "1234"},
+		)
+		w := &nonFlushingResponseWriter{header: make(http.Header)}
+		app.handleStreamEvents(w, request)
+		assert.Equal(http.StatusInternalServerError, w.status)
+	})
+
+	t.Run("Subscribe Error", func(t *testing.T) {
+		assert := assert.New(t)
+		mockSub := new(mockEventSubscriber)
+		mockSub.On("Subscribe", "1234").Return(nil, nil, errors.New("subscribe failed")).Once()
+		app := App{subscriber: mockSub, logger: logging.DefaultLogger()}
+		rr := httptest.NewRecorder()
+		request := mux.SetURLVars(
+			httptest.NewRequest(http.MethodGet, "/1234/events", nil),
+			map[string]string{"deviceID": "1234"},
+		)
+		app.handleStreamEvents(rr, request)
+		assert.Equal(http.StatusInternalServerError, rr.Code)
+	})
+}
+
+// TestHandleStreamEventsLiveAndReplay drives the full streaming handler
+// through a real server so it gets a genuine http.Flusher and a request
+// context that's canceled on client disconnect, exercising Last-Event-ID
+// replay, a live channel push and the ping keep-alive in one pass.
+func TestHandleStreamEventsLiveAndReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	futureTime := time.Now().Add(time.Hour).Unix()
+	goodData, err := json.Marshal(&goodEvent)
+	assert.Nil(err)
+
+	mockGetter := new(mockRecordGetter)
+	mockGetter.On("GetRecordsInRange", mock.Anything, "1234", int64(0), int64(0), 5, uint64(10)).
+		Return([]db.Record{{ID: 11, DeathDate: futureTime, Data: goodData}}, nil).Once()
+
+	liveEvents := make(chan db.Record, 1)
+	mockSub := new(mockEventSubscriber)
+	mockSub.On("Subscribe", "1234").Return((<-chan db.Record)(liveEvents), func() {}, nil).Once()
+
+	originalPingInterval := pingInterval
+	pingInterval = 20 * time.Millisecond
+	defer func() { pingInterval = originalPingInterval }()
+
+	app := &App{eventGetter: mockGetter, subscriber: mockSub, getLimit: 5, logger: logging.DefaultLogger()}
+	router := mux.NewRouter()
+	app.ConfigureRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/device/1234/events", nil)
+	assert.Nil(err)
+	request.Header.Set("Last-Event-ID", "10")
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(err)
+	defer response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Equal("text/event-stream", response.Header.Get("Content-Type"))
+
+	received := &syncBuffer{}
+	go io.Copy(received, response.Body)
+
+	time.Sleep(100 * time.Millisecond)
+	liveEvents <- db.Record{ID: 22, DeathDate: futureTime, Data: goodData}
+	time.Sleep(100 * time.Millisecond)
+
+	body := received.String()
+	assert.Contains(body, "id: 11\n", "replayed record should be written")
+	assert.Contains(body, "id: 22\n", "live record should be written")
+	assert.Contains(body, ":ping", "keep-alive ping should be written")
+}
+
+// TestHandleStreamEventsPartnerFiltering verifies the stream path applies
+// the same partner-scoped authorization as /status, both on replay and on
+// live channel records.
+func TestHandleStreamEventsPartnerFiltering(t *testing.T) {
+	assert := assert.New(t)
+
+	futureTime := time.Now().Add(time.Hour).Unix()
+
+	deniedEvent := goodEvent
+	deniedEvent.PartnerIDs = []string{"other-partner"}
+	deniedData, err := json.Marshal(&deniedEvent)
+	assert.Nil(err)
+
+	allowedEvent := goodEvent
+	allowedEvent.PartnerIDs = []string{"test1"}
+	allowedData, err := json.Marshal(&allowedEvent)
+	assert.Nil(err)
+
+	mockGetter := new(mockRecordGetter)
+	mockGetter.On("GetRecordsInRange", mock.Anything, "1234", int64(0), int64(0), 5, uint64(0)).
+		Return([]db.Record{{ID: 1, DeathDate: futureTime, Data: deniedData}}, nil).Once()
+
+	liveEvents := make(chan db.Record, 1)
+	mockSub := new(mockEventSubscriber)
+	mockSub.On("Subscribe", "1234").Return((<-chan db.Record)(liveEvents), func() {}, nil).Once()
+
+	originalPingInterval := pingInterval
+	pingInterval = time.Hour
+	defer func() { pingInterval = originalPingInterval }()
+
+	p := xmetricstest.NewProvider(nil, Metrics)
+	app := &App{
+		eventGetter: mockGetter,
+		subscriber:  mockSub,
+		authorizer:  AuthorizerFunc(func(r *http.Request) map[string]bool { return map[string]bool{"test1": true} }),
+		measures:    NewMeasures(p),
+		getLimit:    5,
+		logger:      logging.DefaultLogger(),
+	}
+	router := mux.NewRouter()
+	app.ConfigureRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/device/1234/events", nil)
+	assert.Nil(err)
+	request.Header.Set("Last-Event-ID", "0")
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(err)
+	defer response.Body.Close()
+
+	received := &syncBuffer{}
+	go io.Copy(received, response.Body)
+
+	time.Sleep(100 * time.Millisecond)
+	liveEvents <- db.Record{ID: 2, DeathDate: futureTime, Data: allowedData}
+	time.Sleep(100 * time.Millisecond)
+
+	body := received.String()
+	assert.NotContains(body, "id: 1\n", "replayed event for a disallowed partner should be filtered")
+	assert.Contains(body, "id: 2\n", "live event for an allowed partner should be written")
+	p.Assert(t, PartnerFilteredCounter)(xmetricstest.Value(1.0))
+}
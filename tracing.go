@@ -0,0 +1,92 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// applicationName is reported as the service.name resource attribute on
+// every exported span.
+const applicationName = "codex-gungnir"
+
+// TracingConfig is the subsection of this application's configuration that
+// controls span export. It's meant to be populated from the same config
+// loader as the rest of the application, under a "tracing" key. This tree
+// has no main package or config loader to wire that up in yet, so for now
+// NewApp callers construct TracingConfig directly; the first main.go added
+// here should plumb it through from there.
+type TracingConfig struct {
+	// Provider selects the exporter: "jaeger", "otlp", or "" to disable
+	// tracing and use a no-op tracer.
+	Provider string
+	// Endpoint is the collector address for the selected Provider.
+	Endpoint string
+}
+
+// NewTracerProvider builds a trace.TracerProvider for cfg and a shutdown
+// func that must be called to flush buffered spans on exit. An empty
+// Provider yields a no-op tracer rather than an error, so tracing can be
+// left disabled in environments that don't run a collector.
+func NewTracerProvider(cfg TracingConfig) (trace.TracerProvider, func(context.Context) error, error) {
+	if cfg.Provider == "" {
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newSpanExporter(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := resource.New(context.Background(), resource.WithAttributes(semconv.ServiceNameKey.String(applicationName)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return tp, tp.Shutdown, nil
+}
+
+func newSpanExporter(cfg TracingConfig) (sdktrace.SpanExporter, error) {
+	switch cfg.Provider {
+	case "jaeger":
+		exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(cfg.Endpoint)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jaeger exporter: %w", err)
+		}
+		return exporter, nil
+	case "otlp":
+		client := otlptracegrpc.NewClient(otlptracegrpc.WithEndpoint(cfg.Endpoint), otlptracegrpc.WithInsecure())
+		exporter, err := otlptrace.New(context.Background(), client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+		return exporter, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,166 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Comcast/codex/db"
+	"github.com/Comcast/webpa-common/logging"
+)
+
+func TestHandleGetEventsTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	futureTime := time.Now().Add(time.Duration(50000) * time.Minute).Unix()
+	goodData, err := json.Marshal(&goodEvent)
+	assert.Nil(err)
+
+	mockGetter := new(mockRecordGetter)
+	mockGetter.On("GetRecordsInRange", mock.Anything, "1234", int64(0), int64(0), 5, uint64(0)).
+		Return([]db.Record{{ID: 1234, DeathDate: futureTime, Data: goodData}}, nil).Once()
+
+	app := App{
+		eventGetter: mockGetter,
+		getLimit:    5,
+		logger:      logging.DefaultLogger(),
+		tracer:      tp.Tracer(tracerName),
+	}
+
+	request := mux.SetURLVars(
+		httptest.NewRequest(http.MethodGet, "/1234/status", nil),
+		map[string]string{"deviceID": "1234"},
+	)
+	rr := httptest.NewRecorder()
+	app.handleGetEvents(rr, request)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	spans := exporter.GetSpans()
+	assert.Len(spans, 3)
+
+	var handlerSpan, getDeviceInfoSpan, dbSpan tracetest.SpanStub
+	for _, s := range spans {
+		switch s.Name {
+		case "handleGetEvents":
+			handlerSpan = s
+		case "getDeviceInfo":
+			getDeviceInfoSpan = s
+		case "eventGetter.GetRecordsInRange":
+			dbSpan = s
+		}
+	}
+
+	assert.NotEmpty(handlerSpan.Name)
+	assert.NotEmpty(getDeviceInfoSpan.Name)
+	assert.NotEmpty(dbSpan.Name)
+	assert.Equal(handlerSpan.SpanContext.SpanID(), getDeviceInfoSpan.Parent.SpanID())
+	assert.Equal(getDeviceInfoSpan.SpanContext.SpanID(), dbSpan.Parent.SpanID())
+
+	dbAttrs := attributesToMap(dbSpan.Attributes)
+	assert.EqualValues(1, dbAttrs["records.fetched"])
+
+	attrs := attributesToMap(getDeviceInfoSpan.Attributes)
+	assert.Equal("1234", attrs["device.id"])
+	assert.EqualValues(1, attrs["records.returned"])
+	assert.EqualValues(0, attrs["records.expired"])
+	assert.EqualValues(0, attrs["events.unmarshal_failures"])
+
+	handlerAttrs := attributesToMap(handlerSpan.Attributes)
+	assert.EqualValues(http.StatusOK, handlerAttrs["http.status_code"])
+}
+
+func TestHandleGetEventsTracingRecordsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	mockGetter := new(mockRecordGetter)
+	mockGetter.On("GetRecordsInRange", mock.Anything, "1234", int64(0), int64(0), 5, uint64(0)).
+		Return([]db.Record{}, nil).Once()
+
+	app := App{
+		eventGetter: mockGetter,
+		getLimit:    5,
+		logger:      logging.DefaultLogger(),
+		tracer:      tp.Tracer(tracerName),
+	}
+
+	request := mux.SetURLVars(
+		httptest.NewRequest(http.MethodGet, "/1234/status", nil),
+		map[string]string{"deviceID": "1234"},
+	)
+	rr := httptest.NewRecorder()
+	app.handleGetEvents(rr, request)
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "getDeviceInfo" {
+			assert.Equal(codes.Error, s.Status.Code)
+		}
+	}
+}
+
+func TestNewTracerProviderNoProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	tp, shutdown, err := NewTracerProvider(TracingConfig{})
+	assert.Nil(err)
+	assert.NotNil(tp)
+	assert.Nil(shutdown(context.Background()))
+
+	// A no-op provider's tracer must be usable without panicking or
+	// recording anything anywhere.
+	_, span := tp.Tracer(tracerName).Start(context.Background(), "noop-span")
+	span.End()
+}
+
+func TestNewTracerProviderUnknownProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	tp, shutdown, err := NewTracerProvider(TracingConfig{Provider: "not-a-real-exporter"})
+	assert.Nil(tp)
+	assert.Nil(shutdown)
+	assert.NotNil(err)
+}
+
+func attributesToMap(kvs []attribute.KeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		m[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return m
+}